@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// backendView is the JSON representation of a Backend returned by the admin
+// API.
+type backendView struct {
+	URL         string `json:"url"`
+	Alive       bool   `json:"alive"`
+	Weight      int    `json:"weight"`
+	ActiveConns int64  `json:"active_conns"`
+	Circuit     string `json:"circuit"`
+}
+
+func toBackendView(b *Backend) backendView {
+	return backendView{
+		URL:         b.URL.String(),
+		Alive:       b.IsAlive(),
+		Weight:      b.GetWeight(),
+		ActiveConns: b.GetActiveConns(),
+		Circuit:     b.Breaker.State().String(),
+	}
+}
+
+// drainTimeout bounds how long drainAndRemove waits for a backend's
+// in-flight connections to finish before removing it anyway.
+const drainTimeout = 30 * time.Second
+
+// AdminServer exposes an HTTP API for inspecting and mutating the backend
+// pool at runtime: listing and adding backends, draining and removing one,
+// and reloading the backend set from the config file. It shares the
+// package's global serverPool and metrics rather than holding its own
+// copies, so admin changes are immediately visible to the load balancer.
+type AdminServer struct {
+	pool          *ServerPool
+	checker       *HealthChecker
+	breakerConfig CircuitBreakerConfig
+	backoff       BackoffConfig
+	defaultHealth HealthCheckConfig
+	configPath    string
+}
+
+func NewAdminServer(pool *ServerPool, checker *HealthChecker, breakerConfig CircuitBreakerConfig, backoff BackoffConfig, defaultHealth HealthCheckConfig, configPath string) *AdminServer {
+	return &AdminServer{
+		pool:          pool,
+		checker:       checker,
+		breakerConfig: breakerConfig,
+		backoff:       backoff,
+		defaultHealth: defaultHealth,
+		configPath:    configPath,
+	}
+}
+
+// Handler returns the admin API's routes.
+func (a *AdminServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/backends", a.handleBackends)
+	mux.HandleFunc("/backends/", a.handleBackend)
+	mux.HandleFunc("/reload", a.handleReload)
+	return mux
+}
+
+func (a *AdminServer) handleBackends(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		a.listBackends(w, r)
+	case http.MethodPost:
+		a.addBackend(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *AdminServer) listBackends(w http.ResponseWriter, r *http.Request) {
+	backends := a.pool.Snapshot()
+	views := make([]backendView, 0, len(backends))
+	for _, b := range backends {
+		views = append(views, toBackendView(b))
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+type addBackendRequest struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+func (a *AdminServer) addBackend(w http.ResponseWriter, r *http.Request) {
+	var req addBackendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	serverUrl, err := url.Parse(req.URL)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid url: %v", err), http.StatusBadRequest)
+		return
+	}
+	weight := req.Weight
+	if weight <= 0 {
+		weight = 1
+	}
+
+	if a.pool.Lookup(serverUrl) != nil {
+		http.Error(w, "backend already registered", http.StatusConflict)
+		return
+	}
+
+	backend := registerBackend(serverUrl, weight, a.breakerConfig, a.defaultHealth, a.backoff, a.checker)
+	writeJSON(w, http.StatusCreated, toBackendView(backend))
+}
+
+// handleBackend routes /backends/{url} and /backends/{url}/drain, where
+// {url} is the backend's URL-encoded URL.
+func (a *AdminServer) handleBackend(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/backends/")
+	drain := strings.HasSuffix(rest, "/drain")
+	rest = strings.TrimSuffix(rest, "/drain")
+
+	rawUrl, err := url.QueryUnescape(rest)
+	if err != nil || rawUrl == "" {
+		http.Error(w, "invalid backend url", http.StatusBadRequest)
+		return
+	}
+	backendUrl, err := url.Parse(rawUrl)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid backend url: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	backend := a.pool.Lookup(backendUrl)
+	if backend == nil {
+		http.Error(w, "backend not found", http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case drain && r.Method == http.MethodPost:
+		backend.SetAlive(false)
+		writeJSON(w, http.StatusOK, toBackendView(backend))
+	case !drain && r.Method == http.MethodDelete:
+		go drainAndRemove(a.pool, backend)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// drainAndRemove marks backend dead so no new requests are routed to it,
+// waits for its in-flight connections to finish (up to drainTimeout), then
+// removes it from the pool.
+func drainAndRemove(pool *ServerPool, backend *Backend) {
+	backend.SetAlive(false)
+
+	deadline := time.Now().Add(drainTimeout)
+	for backend.GetActiveConns() > 0 && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	pool.RemoveBackend(backend.URL)
+	log.Printf("%s removed from pool\n", backend.URL)
+}
+
+// handleReload re-reads the backend config file given at startup, updating
+// the weight of backends already in the pool and registering any new ones.
+// It never removes backends absent from the file; use DELETE /backends/{url}
+// for that.
+func (a *AdminServer) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.configPath == "" {
+		http.Error(w, "no -config file was provided at startup", http.StatusBadRequest)
+		return
+	}
+
+	fileConfig, err := LoadConfig(a.configPath)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to load config: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	added, updated := 0, 0
+	for _, bc := range fileConfig.Backends {
+		serverUrl, err := url.Parse(bc.URL)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid backend url %q: %v", bc.URL, err), http.StatusInternalServerError)
+			return
+		}
+		weight := bc.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+
+		if backend := a.pool.Lookup(serverUrl); backend != nil {
+			backend.SetWeight(weight)
+			updated++
+			continue
+		}
+
+		healthConfig, err := bc.HealthCheckConfig(a.defaultHealth)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid health check for %q: %v", bc.URL, err), http.StatusInternalServerError)
+			return
+		}
+		registerBackend(serverUrl, weight, a.breakerConfig, healthConfig, a.backoff, a.checker)
+		added++
+	}
+
+	writeJSON(w, http.StatusOK, map[string]int{"added": added, "updated": updated})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
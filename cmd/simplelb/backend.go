@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ewmaDecay is the weight given to the latest latency sample when updating a
+// backend's EWMALatency. Smaller values smooth out spikes more aggressively.
+const ewmaDecay = 0.2
+
+// Backend represents a single upstream server the load balancer can route
+// requests to, along with the live counters balancing strategies use to pick
+// among candidates.
+type Backend struct {
+	URL          *url.URL
+	Alive        bool
+	Weight       int
+	ActiveConns  int64
+	EWMALatency  float64 // milliseconds, exponentially weighted moving average
+	ReverseProxy *httputil.ReverseProxy
+	Breaker      *CircuitBreaker
+	mutex        sync.RWMutex
+}
+
+// Available reports whether b is both marked alive and allowed to take
+// traffic by its circuit breaker.
+func (b *Backend) Available() bool {
+	return b.IsAlive() && b.Breaker.Allow()
+}
+
+func (b *Backend) SetAlive(alive bool) {
+	b.mutex.Lock()
+	b.Alive = alive
+	b.mutex.Unlock()
+}
+
+func (b *Backend) IsAlive() (alive bool) {
+	b.mutex.RLock()
+	alive = b.Alive
+	b.mutex.RUnlock()
+	return
+}
+
+// SetWeight updates b's weight, as used by config hot-reload.
+func (b *Backend) SetWeight(weight int) {
+	b.mutex.Lock()
+	b.Weight = weight
+	b.mutex.Unlock()
+}
+
+// GetWeight returns b's current weight. Balancing strategies read it through
+// here rather than the Weight field directly, since hot-reload can update it
+// concurrently with request handling.
+func (b *Backend) GetWeight() int {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.Weight
+}
+
+// IncActiveConns records that a request has started being proxied to b.
+func (b *Backend) IncActiveConns() {
+	atomic.AddInt64(&b.ActiveConns, 1)
+}
+
+// DecActiveConns records that a request proxied to b has finished.
+func (b *Backend) DecActiveConns() {
+	atomic.AddInt64(&b.ActiveConns, -1)
+}
+
+// GetActiveConns returns the number of requests currently in flight to b.
+func (b *Backend) GetActiveConns() int64 {
+	return atomic.LoadInt64(&b.ActiveConns)
+}
+
+// UpdateLatency folds a new round-trip sample into b's EWMALatency.
+func (b *Backend) UpdateLatency(sample time.Duration) {
+	ms := float64(sample) / float64(time.Millisecond)
+	b.mutex.Lock()
+	if b.EWMALatency == 0 {
+		b.EWMALatency = ms
+	} else {
+		b.EWMALatency = ewmaDecay*ms + (1-ewmaDecay)*b.EWMALatency
+	}
+	b.mutex.Unlock()
+}
+
+// GetLatency returns b's current EWMALatency in milliseconds. A zero value
+// means no samples have been recorded yet.
+func (b *Backend) GetLatency() float64 {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.EWMALatency
+}
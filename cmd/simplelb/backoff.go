@@ -0,0 +1,45 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+)
+
+// BackoffConfig configures the exponential-backoff-with-jitter schedule used
+// between same-backend retries, so many clients failing at once don't retry
+// in lockstep and pile onto a recovering backend.
+type BackoffConfig struct {
+	Initial    time.Duration
+	Multiplier float64
+	Max        time.Duration
+	MaxElapsed time.Duration // total time a single request may spend retrying
+}
+
+// DefaultBackoffConfig is used when the operator doesn't override the
+// backoff flags.
+var DefaultBackoffConfig = BackoffConfig{
+	Initial:    50 * time.Millisecond,
+	Multiplier: 1.5,
+	Max:        2 * time.Second,
+	MaxElapsed: 10 * time.Second,
+}
+
+// Delay returns the backoff duration for the given retry count (0-based),
+// jittered by up to ±50% (sleep = base ± rand*base/2).
+func (c BackoffConfig) Delay(retry int) time.Duration {
+	base := float64(c.Initial)
+	for i := 0; i < retry; i++ {
+		base *= c.Multiplier
+		if base >= float64(c.Max) {
+			base = float64(c.Max)
+			break
+		}
+	}
+
+	jitter := (rand.Float64() - 0.5) * base // ± base/2
+	delay := time.Duration(base + jitter)
+	if delay < 0 {
+		delay = 0
+	}
+	return delay
+}
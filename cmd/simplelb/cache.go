@@ -0,0 +1,435 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheConfig controls the optional in-process response cache for
+// idempotent GET/HEAD requests.
+type CacheConfig struct {
+	Enabled              bool
+	MaxBytes             int64
+	MaxItems             int
+	DefaultTTL           time.Duration
+	StaleWhileRevalidate time.Duration
+	CacheablePaths       []string // path prefixes; empty means every path is eligible
+}
+
+// DefaultCacheConfig matches the cache's behavior when no -cache-* flags are
+// passed: disabled, so it costs nothing until an operator opts in.
+var DefaultCacheConfig = CacheConfig{
+	Enabled:              false,
+	MaxBytes:             64 << 20, // 64 MiB
+	MaxItems:             10000,
+	DefaultTTL:           30 * time.Second,
+	StaleWhileRevalidate: 30 * time.Second,
+}
+
+// cacheEntry is one stored response.
+type cacheEntry struct {
+	status     int
+	header     http.Header
+	body       []byte
+	expiresAt  time.Time
+	staleUntil time.Time
+}
+
+func (e *cacheEntry) fresh(now time.Time) bool  { return now.Before(e.expiresAt) }
+func (e *cacheEntry) usable(now time.Time) bool { return now.Before(e.staleUntil) }
+
+func (e *cacheEntry) cost() int64 {
+	cost := int64(len(e.body))
+	for name, values := range e.header {
+		cost += int64(len(name))
+		for _, v := range values {
+			cost += int64(len(v))
+		}
+	}
+	return cost
+}
+
+type cacheListEntry struct {
+	key   string
+	entry *cacheEntry
+}
+
+// Cache is a bounded-cost, TTL-aware LRU cache for proxied responses. Both
+// the number of items and their total byte cost are capped, and admission
+// of a new key once the cache is full goes through a TinyLFU-style
+// frequency sketch so a single one-off request can't evict a hot entry.
+type Cache struct {
+	config CacheConfig
+
+	mutex     sync.Mutex
+	items     map[string]*list.Element
+	order     *list.List // front = most recently used
+	sizeBytes int64
+	varyHints map[string][]string // base key -> Vary header names learned from stored responses
+
+	sketch   *frequencySketch
+	inflight sync.Map // key -> struct{}, revalidations currently running
+}
+
+func NewCache(config CacheConfig) *Cache {
+	maxItems := config.MaxItems
+	if maxItems <= 0 {
+		maxItems = 1
+	}
+	return &Cache{
+		config:    config,
+		items:     make(map[string]*list.Element),
+		order:     list.New(),
+		varyHints: make(map[string][]string),
+		sketch:    newFrequencySketch(uint32(maxItems) * 4),
+	}
+}
+
+// cacheKey builds the Vary-agnostic base key for r: method, host, path and
+// query.
+func cacheKey(r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(r.Method)
+	b.WriteByte('|')
+	b.WriteString(r.Host)
+	b.WriteByte('|')
+	b.WriteString(r.URL.Path)
+	b.WriteByte('?')
+	b.WriteString(r.URL.RawQuery)
+	return b.String()
+}
+
+func varyHeaderNames(vary string) []string {
+	if vary == "" {
+		return nil
+	}
+	parts := strings.Split(vary, ",")
+	names := make([]string, 0, len(parts))
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p != "" && p != "*" {
+			names = append(names, p)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// varyKey extends baseKey with the values of headerNames taken from r, so
+// responses that vary by e.g. Accept-Encoding don't collide in the cache.
+func varyKey(baseKey string, headerNames []string, r *http.Request) string {
+	if len(headerNames) == 0 {
+		return baseKey
+	}
+	var b strings.Builder
+	b.WriteString(baseKey)
+	for _, name := range headerNames {
+		b.WriteByte('|')
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(r.Header.Get(name))
+	}
+	return b.String()
+}
+
+// lookupKey builds the cache key to use for r, using any Vary header names
+// already learned for r's base key.
+func (c *Cache) lookupKey(baseKey string, r *http.Request) string {
+	c.mutex.Lock()
+	names := c.varyHints[baseKey]
+	c.mutex.Unlock()
+	return varyKey(baseKey, names, r)
+}
+
+// Get returns the entry cached for r, if any, and whether it is still fresh
+// (as opposed to merely usable for stale-while-revalidate).
+func (c *Cache) Get(r *http.Request) (entry *cacheEntry, key string, fresh bool, ok bool) {
+	baseKey := cacheKey(r)
+	key = c.lookupKey(baseKey, r)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	el, found := c.items[key]
+	if !found {
+		return nil, key, false, false
+	}
+
+	entry = el.Value.(*cacheListEntry).entry
+	now := time.Now()
+	if !entry.usable(now) {
+		return nil, key, false, false
+	}
+
+	c.order.MoveToFront(el)
+	return entry, key, entry.fresh(now), true
+}
+
+// Set stores entry under key, deriving Vary-variant lookups for baseKey from
+// entry's Vary header. Once the cache is at capacity, a brand-new key is
+// only admitted if the frequency sketch estimates it as more popular than
+// the item that would otherwise be evicted; on a tie it is not stored.
+func (c *Cache) Set(key, baseKey string, entry *cacheEntry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if el, exists := c.items[key]; exists {
+		old := el.Value.(*cacheListEntry).entry
+		c.sizeBytes += entry.cost() - old.cost()
+		el.Value.(*cacheListEntry).entry = entry
+		c.order.MoveToFront(el)
+		c.evictLocked()
+		return
+	}
+
+	c.sketch.Increment(key)
+	if c.atCapacityLocked() {
+		if victim := c.order.Back(); victim != nil {
+			victimKey := victim.Value.(*cacheListEntry).key
+			if c.sketch.Estimate(key) <= c.sketch.Estimate(victimKey) {
+				return
+			}
+		}
+	}
+
+	el := c.order.PushFront(&cacheListEntry{key: key, entry: entry})
+	c.items[key] = el
+	c.sizeBytes += entry.cost()
+
+	if names := varyHeaderNames(entry.header.Get("Vary")); len(names) > 0 {
+		c.varyHints[baseKey] = names
+	}
+
+	c.evictLocked()
+}
+
+func (c *Cache) atCapacityLocked() bool {
+	return len(c.items) >= c.config.MaxItems || c.sizeBytes >= c.config.MaxBytes
+}
+
+func (c *Cache) evictLocked() {
+	for (len(c.items) > c.config.MaxItems || c.sizeBytes > c.config.MaxBytes) && c.order.Len() > 0 {
+		back := c.order.Back()
+		le := back.Value.(*cacheListEntry)
+		c.order.Remove(back)
+		delete(c.items, le.key)
+		c.sizeBytes -= le.entry.cost()
+	}
+}
+
+// revalidate triggers a background refetch of r through the normal lb
+// handler so a stale-while-revalidate hit gets refreshed without making the
+// client that triggered it wait.
+func (c *Cache) revalidate(r *http.Request) {
+	baseKey := cacheKey(r)
+	key := c.lookupKey(baseKey, r)
+
+	if _, already := c.inflight.LoadOrStore(key, struct{}{}); already {
+		return
+	}
+
+	// Detach from r's context: the inbound request's context is canceled by
+	// net/http as soon as the top-level handler returns, which happens right
+	// after this goroutine is launched, so r.Context() itself would cancel
+	// the refetch before or during the proxied round trip.
+	//
+	// Also give the clone its own ChosenBackend/RetryCounter/AttemptCounter
+	// pointers rather than inheriting r's: lb() writes through those on every
+	// call, and reusing r's would race with accessLogMiddleware reading them
+	// for the original request's access log line.
+	ctx := context.WithoutCancel(r.Context())
+	ctx = context.WithValue(ctx, ChosenBackend, new(string))
+	ctx = context.WithValue(ctx, RetryCounter, new(int))
+	ctx = context.WithValue(ctx, AttemptCounter, new(int))
+	reqClone := r.Clone(ctx)
+	go func() {
+		defer c.inflight.Delete(key)
+
+		rec := &cachingResponseWriter{ResponseWriter: newDiscardResponseWriter(), status: http.StatusOK}
+		lb(rec, reqClone)
+		storeIfCacheable(c, reqClone, rec)
+	}()
+}
+
+// frequencySketch is a minimal count-min sketch used to decide whether a
+// newly-missed key is popular enough to admit into a full cache (TinyLFU-
+// style admission), so a single one-off request can't evict a hot entry.
+type frequencySketch struct {
+	mutex       sync.Mutex
+	width       uint32
+	depth       int
+	counters    [][]uint8
+	samples     uint64
+	sampleLimit uint64
+}
+
+const frequencySketchMaxCount = 15 // counters are halved (aged) periodically, so 4 bits is plenty
+
+func newFrequencySketch(width uint32) *frequencySketch {
+	if width == 0 {
+		width = 1
+	}
+	const depth = 4
+	counters := make([][]uint8, depth)
+	for i := range counters {
+		counters[i] = make([]uint8, width)
+	}
+	return &frequencySketch{
+		width:       width,
+		depth:       depth,
+		counters:    counters,
+		sampleLimit: uint64(width) * 10,
+	}
+}
+
+func (f *frequencySketch) hash(key string, seed int) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte{byte(seed)})
+	_, _ = h.Write([]byte(key))
+	return h.Sum32() % f.width
+}
+
+func (f *frequencySketch) Increment(key string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for i := 0; i < f.depth; i++ {
+		idx := f.hash(key, i)
+		if f.counters[i][idx] < frequencySketchMaxCount {
+			f.counters[i][idx]++
+		}
+	}
+
+	f.samples++
+	if f.samples >= f.sampleLimit {
+		for i := range f.counters {
+			for j := range f.counters[i] {
+				f.counters[i][j] /= 2
+			}
+		}
+		f.samples /= 2
+	}
+}
+
+func (f *frequencySketch) Estimate(key string) uint8 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	min := uint8(frequencySketchMaxCount)
+	for i := 0; i < f.depth; i++ {
+		if c := f.counters[i][f.hash(key, i)]; c < min {
+			min = c
+		}
+	}
+	return min
+}
+
+// cacheControl is the subset of Cache-Control directives the cache acts on.
+type cacheControl struct {
+	noStore              bool
+	private              bool
+	maxAge               int // -1 if absent
+	staleWhileRevalidate int // -1 if absent
+}
+
+func parseCacheControl(value string) cacheControl {
+	cc := cacheControl{maxAge: -1, staleWhileRevalidate: -1}
+	for _, directive := range strings.Split(value, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store":
+			cc.noStore = true
+		case "private":
+			cc.private = true
+		case "max-age":
+			if v, err := strconv.Atoi(arg); err == nil {
+				cc.maxAge = v
+			}
+		case "stale-while-revalidate":
+			if v, err := strconv.Atoi(arg); err == nil {
+				cc.staleWhileRevalidate = v
+			}
+		}
+	}
+	return cc
+}
+
+// cacheableRequest reports whether r may be served from, or written into,
+// the cache. Requests carrying an Authorization header always bypass it.
+func cacheableRequest(config CacheConfig, r *http.Request) bool {
+	if !config.Enabled {
+		return false
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if r.Header.Get("Authorization") != "" {
+		return false
+	}
+	if len(config.CacheablePaths) == 0 {
+		return true
+	}
+	for _, prefix := range config.CacheablePaths {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheableStatusCodes are response codes cacheable per RFC 7231 §6.1 that
+// this cache bothers to store.
+var cacheableStatusCodes = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusPartialContent:       true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusGone:                 true,
+}
+
+// cacheableResponse reports whether a response may be cached, returning its
+// TTL (from Cache-Control max-age / Expires, falling back to the cache's
+// default) and its stale-while-revalidate window. Set-Cookie always bypasses
+// the cache.
+func cacheableResponse(config CacheConfig, header http.Header, status int) (ttl, swr time.Duration, ok bool) {
+	if !cacheableStatusCodes[status] {
+		return 0, 0, false
+	}
+	if header.Get("Set-Cookie") != "" {
+		return 0, 0, false
+	}
+
+	cc := parseCacheControl(header.Get("Cache-Control"))
+	if cc.noStore || cc.private {
+		return 0, 0, false
+	}
+
+	ttl = config.DefaultTTL
+	switch {
+	case cc.maxAge >= 0:
+		ttl = time.Duration(cc.maxAge) * time.Second
+	case header.Get("Expires") != "":
+		if t, err := http.ParseTime(header.Get("Expires")); err == nil {
+			ttl = time.Until(t)
+		}
+	}
+	if ttl <= 0 {
+		return 0, 0, false
+	}
+
+	swr = config.StaleWhileRevalidate
+	if cc.staleWhileRevalidate >= 0 {
+		swr = time.Duration(cc.staleWhileRevalidate) * time.Second
+	}
+	return ttl, swr, true
+}
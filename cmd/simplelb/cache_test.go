@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCacheableResponseHonorsCacheControl(t *testing.T) {
+	cfg := CacheConfig{DefaultTTL: 30 * time.Second, StaleWhileRevalidate: 10 * time.Second}
+
+	tests := []struct {
+		name    string
+		status  int
+		header  http.Header
+		wantOK  bool
+		wantTTL time.Duration
+	}{
+		{
+			name:    "no cache-control falls back to default ttl",
+			status:  http.StatusOK,
+			header:  http.Header{},
+			wantOK:  true,
+			wantTTL: 30 * time.Second,
+		},
+		{
+			name:    "max-age overrides default ttl",
+			status:  http.StatusOK,
+			header:  http.Header{"Cache-Control": {"max-age=5"}},
+			wantOK:  true,
+			wantTTL: 5 * time.Second,
+		},
+		{
+			name:   "no-store bypasses cache",
+			status: http.StatusOK,
+			header: http.Header{"Cache-Control": {"no-store"}},
+			wantOK: false,
+		},
+		{
+			name:   "private bypasses cache",
+			status: http.StatusOK,
+			header: http.Header{"Cache-Control": {"private"}},
+			wantOK: false,
+		},
+		{
+			name:   "set-cookie always bypasses cache",
+			status: http.StatusOK,
+			header: http.Header{"Set-Cookie": {"sid=1"}},
+			wantOK: false,
+		},
+		{
+			name:   "non-cacheable status",
+			status: http.StatusInternalServerError,
+			header: http.Header{},
+			wantOK: false,
+		},
+		{
+			name:   "max-age=0 is not cacheable",
+			status: http.StatusOK,
+			header: http.Header{"Cache-Control": {"max-age=0"}},
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ttl, _, ok := cacheableResponse(cfg, tt.header, tt.status)
+			if ok != tt.wantOK {
+				t.Fatalf("cacheableResponse() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && ttl != tt.wantTTL {
+				t.Fatalf("cacheableResponse() ttl = %v, want %v", ttl, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func TestCacheableRequestBypassesAuthAndNonIdempotent(t *testing.T) {
+	cfg := CacheConfig{Enabled: true}
+
+	get, _ := http.NewRequest(http.MethodGet, "http://x/a", nil)
+	post, _ := http.NewRequest(http.MethodPost, "http://x/a", nil)
+	authed, _ := http.NewRequest(http.MethodGet, "http://x/a", nil)
+	authed.Header.Set("Authorization", "Bearer token")
+
+	if !cacheableRequest(cfg, get) {
+		t.Error("GET should be cacheable")
+	}
+	if cacheableRequest(cfg, post) {
+		t.Error("POST should not be cacheable")
+	}
+	if cacheableRequest(cfg, authed) {
+		t.Error("a request carrying Authorization should bypass the cache")
+	}
+	if cacheableRequest(CacheConfig{Enabled: false}, get) {
+		t.Error("cache should refuse everything when disabled")
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewCache(CacheConfig{MaxItems: 2, MaxBytes: 1 << 20})
+
+	put := func(key string) {
+		c.Set(key, key, &cacheEntry{
+			status:    http.StatusOK,
+			header:    http.Header{},
+			expiresAt: time.Now().Add(time.Minute),
+		})
+	}
+
+	put("a")
+	put("b")
+	// Give "c" a frequency estimate high enough to clear TinyLFU admission
+	// against "a", the item that would otherwise be evicted.
+	for i := 0; i < 5; i++ {
+		c.sketch.Increment("c")
+	}
+	put("c") // cache is now at capacity; "a" is the least recently used and should go
+
+	if _, ok := c.items["a"]; ok {
+		t.Error("expected the least recently used entry to be evicted")
+	}
+	if _, ok := c.items["b"]; !ok {
+		t.Error("expected \"b\" to still be cached")
+	}
+	if _, ok := c.items["c"]; !ok {
+		t.Error("expected \"c\" to still be cached")
+	}
+}
+
+func TestFrequencySketchEstimateTracksIncrements(t *testing.T) {
+	sketch := newFrequencySketch(1024)
+
+	if got := sketch.Estimate("hot"); got != 0 {
+		t.Fatalf("Estimate() on an untouched key = %d, want 0", got)
+	}
+
+	for i := 0; i < 3; i++ {
+		sketch.Increment("hot")
+	}
+	sketch.Increment("cold")
+
+	hot, cold := sketch.Estimate("hot"), sketch.Estimate("cold")
+	if hot <= cold {
+		t.Fatalf("Estimate(hot) = %d should be greater than Estimate(cold) = %d", hot, cold)
+	}
+}
+
+func TestFrequencySketchCountersStayWithinMaxCount(t *testing.T) {
+	sketch := newFrequencySketch(4) // tiny width keeps sampleLimit small for the test
+
+	for i := 0; i < int(sketch.sampleLimit)*2; i++ {
+		sketch.Increment(fmt.Sprintf("key-%d", i))
+	}
+
+	// Even with enough increments for aging to kick in repeatedly, no
+	// counter should be able to exceed the sketch's saturation ceiling.
+	for _, row := range sketch.counters {
+		for _, v := range row {
+			if v > frequencySketchMaxCount {
+				t.Fatalf("counter %d exceeds frequencySketchMaxCount", v)
+			}
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+)
+
+var responseCache = NewCache(DefaultCacheConfig)
+
+// cachingResponseWriter buffers a response's body so it can be stored in
+// the cache once the handler finishes, while still streaming it to the
+// real client as it's written.
+type cachingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *cachingResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *cachingResponseWriter) Write(p []byte) (int, error) {
+	w.body.Write(p)
+	return w.ResponseWriter.Write(p)
+}
+
+// discardResponseWriter satisfies http.ResponseWriter without writing
+// anywhere, so a background revalidation fetch can reuse cachingResponseWriter
+// to capture a cacheable response without a real client attached.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func newDiscardResponseWriter() *discardResponseWriter {
+	return &discardResponseWriter{header: make(http.Header)}
+}
+
+func (d *discardResponseWriter) Header() http.Header         { return d.header }
+func (d *discardResponseWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (d *discardResponseWriter) WriteHeader(int)             {}
+
+// storeIfCacheable writes rec's captured response into c under the key for
+// r, if cacheableResponse allows it.
+func storeIfCacheable(c *Cache, r *http.Request, rec *cachingResponseWriter) {
+	ttl, swr, ok := cacheableResponse(c.config, rec.Header(), rec.status)
+	if !ok {
+		return
+	}
+
+	baseKey := cacheKey(r)
+	key := c.lookupKey(baseKey, r)
+	now := time.Now()
+	c.Set(key, baseKey, &cacheEntry{
+		status:     rec.status,
+		header:     rec.Header().Clone(),
+		body:       append([]byte(nil), rec.body.Bytes()...),
+		expiresAt:  now.Add(ttl),
+		staleUntil: now.Add(ttl + swr),
+	})
+}
+
+// writeCachedEntry writes a stored cacheEntry to w as the actual HTTP
+// response, tagging it so clients and operators can tell a cache hit from a
+// live proxy response.
+func writeCachedEntry(w http.ResponseWriter, entry *cacheEntry) {
+	for name, values := range entry.header {
+		for _, v := range values {
+			w.Header().Add(name, v)
+		}
+	}
+	w.Header().Set("X-Cache", "HIT")
+	w.WriteHeader(entry.status)
+	_, _ = w.Write(entry.body)
+}
+
+// cacheMiddleware serves cacheable GET/HEAD requests from responseCache
+// when possible, triggering a background refetch through next when a hit is
+// stale but still within its stale-while-revalidate window, and otherwise
+// runs next and stores the response if it turns out to be cacheable.
+func cacheMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !cacheableRequest(responseCache.config, r) {
+			next(w, r)
+			return
+		}
+
+		if entry, _, fresh, ok := responseCache.Get(r); ok {
+			writeCachedEntry(w, entry)
+			if !fresh {
+				responseCache.revalidate(r)
+			}
+			return
+		}
+
+		rec := &cachingResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+		storeIfCacheable(responseCache, r, rec)
+	}
+}
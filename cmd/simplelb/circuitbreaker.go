@@ -0,0 +1,124 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of a Backend's circuit breaker.
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreakerConfig controls when a backend's circuit trips and how long
+// it stays open before a probe request is allowed through.
+type CircuitBreakerConfig struct {
+	FailureThreshold int           // consecutive failures within Window that open the circuit
+	Window           time.Duration // span a run of consecutive failures must fall within
+	CooldownPeriod   time.Duration // time Open is held before moving to HalfOpen
+}
+
+// DefaultCircuitBreakerConfig matches the load balancer's historical
+// behavior closely enough to use as a sane out-of-the-box default.
+var DefaultCircuitBreakerConfig = CircuitBreakerConfig{
+	FailureThreshold: 5,
+	Window:           10 * time.Second,
+	CooldownPeriod:   5 * time.Second,
+}
+
+// CircuitBreaker tracks a backend's recent failures/successes and decides
+// whether requests should be allowed to reach it. It lets lb short-circuit
+// routing to a failing backend without waiting for the next health check.
+type CircuitBreaker struct {
+	config CircuitBreakerConfig
+
+	mutex            sync.Mutex
+	state            CircuitState
+	consecutiveFails int
+	firstFailAt      time.Time
+	openedAt         time.Time
+}
+
+func NewCircuitBreaker(config CircuitBreakerConfig) *CircuitBreaker {
+	return &CircuitBreaker{config: config, state: CircuitClosed}
+}
+
+// State returns the breaker's current state, resolving Open -> HalfOpen once
+// the cooldown period has elapsed.
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	cb.resolveCooldownLocked()
+	return cb.state
+}
+
+func (cb *CircuitBreaker) resolveCooldownLocked() {
+	if cb.state == CircuitOpen && time.Since(cb.openedAt) >= cb.config.CooldownPeriod {
+		cb.state = CircuitHalfOpen
+	}
+}
+
+// Allow reports whether a request may be sent to the backend this breaker
+// guards (state is Closed or HalfOpen). Open rejects until the cooldown
+// elapses and the breaker moves to HalfOpen to let a probe through.
+func (cb *CircuitBreaker) Allow() bool {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	cb.resolveCooldownLocked()
+	return cb.state != CircuitOpen
+}
+
+// RecordSuccess closes the circuit and resets the failure run.
+func (cb *CircuitBreaker) RecordSuccess() {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	cb.state = CircuitClosed
+	cb.consecutiveFails = 0
+}
+
+// RecordFailure registers a failed request. Once FailureThreshold consecutive
+// failures land within Window, the circuit opens; a failed probe in
+// HalfOpen re-opens it immediately.
+func (cb *CircuitBreaker) RecordFailure() {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if cb.state == CircuitHalfOpen {
+		cb.open()
+		return
+	}
+
+	now := time.Now()
+	if cb.consecutiveFails == 0 || now.Sub(cb.firstFailAt) > cb.config.Window {
+		cb.firstFailAt = now
+		cb.consecutiveFails = 0
+	}
+	cb.consecutiveFails++
+
+	if cb.consecutiveFails >= cb.config.FailureThreshold {
+		cb.open()
+	}
+}
+
+func (cb *CircuitBreaker) open() {
+	cb.state = CircuitOpen
+	cb.openedAt = time.Now()
+	cb.consecutiveFails = 0
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerOpensAtThreshold(t *testing.T) {
+	cb := NewCircuitBreaker(CircuitBreakerConfig{
+		FailureThreshold: 3,
+		Window:           time.Second,
+		CooldownPeriod:   time.Hour,
+	})
+
+	for i := 0; i < 2; i++ {
+		cb.RecordFailure()
+		if !cb.Allow() {
+			t.Fatalf("failure %d: circuit should still be closed below the threshold", i+1)
+		}
+	}
+
+	cb.RecordFailure()
+	if cb.Allow() {
+		t.Fatal("circuit should be open once FailureThreshold consecutive failures land")
+	}
+	if got := cb.State(); got != CircuitOpen {
+		t.Fatalf("State() = %v, want CircuitOpen", got)
+	}
+}
+
+func TestCircuitBreakerResetsOutsideWindow(t *testing.T) {
+	cb := NewCircuitBreaker(CircuitBreakerConfig{
+		FailureThreshold: 2,
+		Window:           10 * time.Millisecond,
+		CooldownPeriod:   time.Hour,
+	})
+
+	cb.RecordFailure()
+	time.Sleep(20 * time.Millisecond)
+	cb.RecordFailure() // outside the window: should restart the failure run, not trip the breaker
+
+	if !cb.Allow() {
+		t.Fatal("circuit should stay closed when failures are not consecutive within Window")
+	}
+}
+
+func TestCircuitBreakerHalfOpenAfterCooldown(t *testing.T) {
+	cb := NewCircuitBreaker(CircuitBreakerConfig{
+		FailureThreshold: 1,
+		Window:           time.Second,
+		CooldownPeriod:   10 * time.Millisecond,
+	})
+
+	cb.RecordFailure()
+	if cb.Allow() {
+		t.Fatal("circuit should be open immediately after tripping")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if !cb.Allow() {
+		t.Fatal("circuit should allow a probe request once the cooldown elapses")
+	}
+	if got := cb.State(); got != CircuitHalfOpen {
+		t.Fatalf("State() = %v, want CircuitHalfOpen", got)
+	}
+}
+
+func TestCircuitBreakerHalfOpenFailureReopens(t *testing.T) {
+	cb := NewCircuitBreaker(CircuitBreakerConfig{
+		FailureThreshold: 1,
+		Window:           time.Second,
+		CooldownPeriod:   time.Millisecond,
+	})
+
+	cb.RecordFailure()
+	time.Sleep(5 * time.Millisecond)
+	if cb.State() != CircuitHalfOpen {
+		t.Fatal("expected breaker to be half-open before the probe")
+	}
+
+	cb.RecordFailure() // failed probe
+	if cb.Allow() {
+		t.Fatal("a failed half-open probe should reopen the circuit")
+	}
+}
+
+func TestCircuitBreakerSuccessClosesCircuit(t *testing.T) {
+	cb := NewCircuitBreaker(CircuitBreakerConfig{
+		FailureThreshold: 1,
+		Window:           time.Second,
+		CooldownPeriod:   time.Millisecond,
+	})
+
+	cb.RecordFailure()
+	time.Sleep(5 * time.Millisecond)
+	cb.RecordSuccess() // successful half-open probe
+
+	if got := cb.State(); got != CircuitClosed {
+		t.Fatalf("State() = %v, want CircuitClosed after a successful probe", got)
+	}
+	if !cb.Allow() {
+		t.Fatal("closed circuit should allow requests")
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// FileConfig is the top-level shape of a -config file, letting operators
+// describe backends with per-backend health check settings instead of the
+// flat comma-separated -backends flag.
+type FileConfig struct {
+	Backends []BackendConfig `json:"backends"`
+}
+
+// BackendConfig describes one backend as loaded from a -config file.
+type BackendConfig struct {
+	URL         string                 `json:"url"`
+	Weight      int                    `json:"weight"`
+	HealthCheck *HealthCheckFileConfig `json:"healthCheck,omitempty"`
+}
+
+// HealthCheckFileConfig is the on-disk representation of a
+// HealthCheckConfig; durations are parsed with time.ParseDuration (e.g.
+// "5s").
+type HealthCheckFileConfig struct {
+	Kind               string `json:"kind"` // "tcp" (default), "http", or "https"
+	Path               string `json:"path,omitempty"`
+	ExpectedCodes      []int  `json:"expectedCodes,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+	Interval           string `json:"interval,omitempty"`
+	Timeout            string `json:"timeout,omitempty"`
+	UnhealthyThreshold int    `json:"unhealthyThreshold,omitempty"`
+	HealthyThreshold   int    `json:"healthyThreshold,omitempty"`
+}
+
+// LoadConfig reads and parses a backend config file. Only JSON is decoded
+// directly; since the standard library has no YAML decoder and this repo
+// takes on no external dependencies, a YAML file must be written as valid
+// JSON (which is itself valid YAML) to load here.
+func LoadConfig(path string) (*FileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config FileConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return &config, nil
+}
+
+// HealthCheckConfig resolves c's health check settings against defaults,
+// returning defaults unchanged when c has none.
+func (c BackendConfig) HealthCheckConfig(defaults HealthCheckConfig) (HealthCheckConfig, error) {
+	if c.HealthCheck == nil {
+		return defaults, nil
+	}
+	hc := c.HealthCheck
+	config := defaults
+
+	if hc.Interval != "" {
+		d, err := time.ParseDuration(hc.Interval)
+		if err != nil {
+			return HealthCheckConfig{}, fmt.Errorf("invalid interval %q: %w", hc.Interval, err)
+		}
+		config.Interval = d
+	}
+	if hc.Timeout != "" {
+		d, err := time.ParseDuration(hc.Timeout)
+		if err != nil {
+			return HealthCheckConfig{}, fmt.Errorf("invalid timeout %q: %w", hc.Timeout, err)
+		}
+		config.Timeout = d
+	}
+	if hc.UnhealthyThreshold > 0 {
+		config.UnhealthyThreshold = hc.UnhealthyThreshold
+	}
+	if hc.HealthyThreshold > 0 {
+		config.HealthyThreshold = hc.HealthyThreshold
+	}
+
+	switch hc.Kind {
+	case "", "tcp":
+		config.Probe = TCPProbe{Timeout: config.Timeout}
+	case "http":
+		config.Probe = HTTPProbe{Path: hc.Path, ExpectedCodes: hc.ExpectedCodes, Timeout: config.Timeout}
+	case "https":
+		config.Probe = HTTPProbe{
+			Path:                  hc.Path,
+			ExpectedCodes:         hc.ExpectedCodes,
+			Timeout:               config.Timeout,
+			TLSInsecureSkipVerify: hc.InsecureSkipVerify,
+		}
+	default:
+		return HealthCheckConfig{}, fmt.Errorf("unknown health check kind %q", hc.Kind)
+	}
+
+	return config, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// HealthCheckConfig controls how a single backend's active probe runs.
+type HealthCheckConfig struct {
+	Interval           time.Duration
+	Timeout            time.Duration
+	UnhealthyThreshold int // consecutive failures to flip alive -> dead
+	HealthyThreshold   int // consecutive successes to flip dead -> alive
+	Probe              Probe
+}
+
+// DefaultHealthCheckConfig reproduces the load balancer's original health
+// check: a plain TCP dial every 20 seconds, flipping state on a single
+// failure or success.
+var DefaultHealthCheckConfig = HealthCheckConfig{
+	Interval:           20 * time.Second,
+	Timeout:            2 * time.Second,
+	UnhealthyThreshold: 1,
+	HealthyThreshold:   1,
+	Probe:              TCPProbe{Timeout: 2 * time.Second},
+}
+
+// HealthChecker runs one independent probing goroutine per backend and
+// flips each backend's alive state once its consecutive-failure or
+// consecutive-success threshold is crossed; a backend it brings back up also
+// has its circuit breaker reset to closed. The passive failures
+// instrumentProxy and proxy.ErrorHandler observe land on Backend.Breaker
+// instead, and Backend.Available combines the two, so both feed a single
+// alive/degraded/dead state machine.
+type HealthChecker struct {
+	pool *ServerPool
+	stop chan struct{}
+}
+
+func NewHealthChecker(pool *ServerPool) *HealthChecker {
+	return &HealthChecker{pool: pool, stop: make(chan struct{})}
+}
+
+// StartFor launches b's probing goroutine using config. Backends added at
+// runtime call this the same way startup-time backends do, so there's a
+// single code path for bringing a backend under health-check supervision.
+func (h *HealthChecker) StartFor(b *Backend, config HealthCheckConfig) {
+	go h.run(b, config)
+}
+
+// Stop signals every probing goroutine to exit.
+func (h *HealthChecker) Stop() {
+	close(h.stop)
+}
+
+func (h *HealthChecker) run(b *Backend, config HealthCheckConfig) {
+	consecutiveFails, consecutiveOK := 0, 0
+	probeOnce := func() {
+		start := time.Now()
+		err := config.Probe.Check(b)
+		metrics.ObserveHealthCheck(time.Since(start))
+
+		if err != nil {
+			consecutiveFails++
+			consecutiveOK = 0
+			if b.IsAlive() && consecutiveFails >= config.UnhealthyThreshold {
+				log.Printf("%s [down] %v\n", b.URL, err)
+				b.SetAlive(false)
+			}
+			return
+		}
+
+		consecutiveOK++
+		consecutiveFails = 0
+		if !b.IsAlive() && consecutiveOK >= config.HealthyThreshold {
+			log.Printf("%s [up]\n", b.URL)
+			b.SetAlive(true)
+			b.Breaker.RecordSuccess()
+		}
+	}
+
+	probeOnce() // first check is forced, matching the load balancer's historical behavior
+
+	t := time.NewTicker(config.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			probeOnce()
+		case <-h.stop:
+			return
+		}
+	}
+}
@@ -1,124 +1,31 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"log"
-	"strings"
-	"net"
-	"net/url"
-	"net/http/httputil"
+	"log/slog"
 	"net/http"
-	"fmt"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
-	"sync/atomic"
-	"sync"
-	"context"
 )
 
 const (
 	Attempt int = iota
 	Retry
+	RetryStart
+	ChosenBackend
+	RetryCounter
+	AttemptCounter
 )
 
-type Backend struct {
-	URL *url.URL
-	Alive bool
-	ReverseProxy *httputil.ReverseProxy
-	mutex sync.RWMutex
-}
-
-func (b *Backend) SetAlive(alive bool) {
-	b.mutex.Lock()
-	b.Alive = alive
-	b.mutex.Unlock()
-}
-
-func (b *Backend) IsAlive() (alive bool) {
-	b.mutex.RLock()
-	alive = b.Alive
-	b.mutex.RUnlock()
-	return
-}
-
-type ServerPool struct {
-	backends []*Backend
-	currentIndex uint64
-}
-
-func (s *ServerPool) AddBackend(backend *Backend) {
-	s.backends = append(s.backends, backend)
-}
-
-func (s *ServerPool) NextIndex() int {
-	return int(atomic.AddUint64(&s.currentIndex, uint64(1)) % uint64(len(s.backends)))
-}
-
-func (s *ServerPool) MarkBackendStatus(backendUrl *url.URL, alive bool){
-	for _, b := range s.backends {
-		if b.URL.String() == backendUrl.String() {
-			b.SetAlive(alive)
-			return
-		}
-	}
-}
-
-func (s *ServerPool) GetNextPeer() *Backend{
-	next := s.NextIndex()
-	limit := next + len(s.backends)
-
-	for i := next; i < limit; i++ {
-		idx := i % len(s.backends)
-		if s.backends[idx].IsAlive() {
-			if i != next {
-				atomic.StoreUint64(&s.currentIndex, uint64(idx))
-			}
-			return s.backends[idx]
-		}
-	}
-	return nil
-}
-
-// Health check for backends and update the status
-func (s *ServerPool) HealthCheck() {
-	for _, b := range s.backends {
-		status := "up"
-		if isBackendAlive(b.URL) {
-			b.SetAlive(true)
-		}else {
-			b.SetAlive(false)
-			status = "down"
-		}
-		log.Printf("%s [%s]\n", b.URL, status)
-	}
-}
-
-// isBackendAlive checks if backend is alive by establishing a TCP connection and then closing the connection on result
-func isBackendAlive(url *url.URL) bool {
-	timeout := 2 * time.Second
-	conn, err := net.DialTimeout("tcp", url.Host, timeout)
-	if err != nil {
-		log.Println("Site unreachable, error: ", err)
-		return false
-	}
-	_ = conn.Close()
-	return true
-}
-
-// HealthCheck runs serverpool health check every 20 seconds
-func healthCheck() {
-	serverPool.HealthCheck() // First is forced call
-
-	t := time.NewTicker(time.Second * 20)
-	for {
-		select {
-		case <-t.C:
-			log.Println("Starting Health check...")
-			serverPool.HealthCheck()
-			log.Println("Health Check completed.")
-		}
-	}
-}
-
 // GetRetryFromContext return current retry count for given request
 func GetRetryFromContext(r *http.Request) int {
 	if retry, ok := r.Context().Value(Retry).(int); ok {
@@ -134,7 +41,24 @@ func GetAttemptsFromContext(r *http.Request) int {
 	return 0
 }
 
-func lb(w http.ResponseWriter, r *http.Request){
+// bumpRetryCounter and bumpAttemptCounter increment the shared counters
+// withRequestCounters attached to r's context, if present, so
+// accessLogMiddleware can report the totals from the original request object
+// after ErrorHandler's retries/failovers -- which run against derived
+// contexts via r.WithContext -- have completed.
+func bumpRetryCounter(r *http.Request) {
+	if c, ok := r.Context().Value(RetryCounter).(*int); ok {
+		*c++
+	}
+}
+
+func bumpAttemptCounter(r *http.Request) {
+	if c, ok := r.Context().Value(AttemptCounter).(*int); ok {
+		*c++
+	}
+}
+
+func lb(w http.ResponseWriter, r *http.Request) {
 
 	attempts := GetAttemptsFromContext(r)
 	if attempts > 3 {
@@ -143,17 +67,21 @@ func lb(w http.ResponseWriter, r *http.Request){
 		return
 	}
 
-	peer := serverPool.GetNextPeer()
+	peer := serverPool.GetNextPeer(r)
 
 	if peer != nil {
-		fmt.Println("Proxying request to backend server: ", peer.URL)
+		if backend, ok := r.Context().Value(ChosenBackend).(*string); ok {
+			*backend = peer.URL.String()
+		}
 		peer.ReverseProxy.ServeHTTP(w, r)
-		return 
+		return
 	}
 	http.Error(w, "Service Not Available", http.StatusServiceUnavailable)
 }
 
 var serverPool ServerPool
+var metrics = NewMetrics()
+var accessLogger *slog.Logger
 
 /*
 https://kasvith.github.io/posts/lets-create-a-simple-lb-go/
@@ -161,76 +89,249 @@ https://github.com/kasvith/simplelb/blob/master/main.go
 // Postman stress testing
 */
 
-func main(){
+// parseBackend splits a "-backends" token into its URL and optional weight,
+// given as "url" or "url=weight". A missing or non-positive weight defaults
+// to 1.
+func parseBackend(tok string) (serverUrl *url.URL, weight int, err error) {
+	urlPart, weightPart, hasWeight := strings.Cut(tok, "=")
+
+	serverUrl, err = url.Parse(urlPart)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	weight = 1
+	if hasWeight {
+		weight, err = strconv.Atoi(weightPart)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid weight in %q: %w", tok, err)
+		}
+		if weight <= 0 {
+			weight = 1
+		}
+	}
+	return serverUrl, weight, nil
+}
+
+// registerBackend builds the reverse proxy and retry/circuit-breaker wiring
+// for one backend, adds it to the pool, and starts its active health check
+// under checker. It's used both at startup and by the admin API's
+// POST /backends, so a backend added at runtime is wired up identically to
+// one configured up front.
+func registerBackend(serverUrl *url.URL, weight int, breakerConfig CircuitBreakerConfig, healthConfig HealthCheckConfig, backoff BackoffConfig, checker *HealthChecker) *Backend {
+	proxy := httputil.NewSingleHostReverseProxy(serverUrl)
+	backend := &Backend{
+		URL:          serverUrl,
+		Alive:        true,
+		Weight:       weight,
+		ReverseProxy: proxy,
+		Breaker:      NewCircuitBreaker(breakerConfig),
+	}
+
+	// ErrorHandler retries the request against this same backend, waiting
+	// backoff.Delay between tries, for as long as backoff.MaxElapsed has not
+	// passed and the backend's circuit breaker allows it. After that it feeds
+	// the breaker a failure and routes the request to another backend through
+	// lb, counting the attempt; lb answers 503 once more than 3 such attempts
+	// have been made.
+
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, e error) {
+		log.Printf("[%s] %s\n", serverUrl.Host, e.Error())
+		retries := GetRetryFromContext(r)
+
+		start, ok := r.Context().Value(RetryStart).(time.Time)
+		if !ok {
+			start = time.Now()
+		}
+		if time.Since(start) < backoff.MaxElapsed && backend.Breaker.Allow() {
+			metrics.IncRetries()
+			bumpRetryCounter(r)
+			select {
+			case <-time.After(backoff.Delay(retries)):
+				ctx := context.WithValue(r.Context(), Retry, retries+1)
+				ctx = context.WithValue(ctx, RetryStart, start)
+				proxy.ServeHTTP(w, r.WithContext(ctx))
+			}
+			return
+		}
+		// Retry budget against this backend is spent, or its circuit already
+		// tripped open mid-retry: feed the breaker a failure (a no-op if it's
+		// already open) and route the request to another backend instead of
+		// continuing to hammer this one.
+		serverPool.RecordBackendFailure(serverUrl)
+
+		// Send this request to another backend, increment attempt count
+		// Handle attempts count limit in lb request handler function
+		attempts := GetAttemptsFromContext(r)
+		bumpAttemptCounter(r)
+		log.Printf("%s (%s) Attempting request to another backend %d\n", r.RemoteAddr, r.URL.Path, attempts)
+		ctx := context.WithValue(r.Context(), Attempt, attempts+1)
+		lb(w, r.WithContext(ctx))
+	}
+
+	instrumentProxy(proxy, backend)
+
+	serverPool.AddBackend(backend)
+	checker.StartFor(backend, healthConfig)
+	log.Printf("Configured server: %s (weight %d)\n", serverUrl, weight)
+	return backend
+}
+
+func main() {
 	var serverList string
+	var configPath string
 	var port int
+	var strategyName string
+	var backoffInitial, backoffMax, backoffMaxElapsed time.Duration
+	var breakerThreshold int
+	var breakerWindow, breakerCooldown time.Duration
+	var logFormat string
+	var cacheEnabled bool
+	var cacheMaxBytes int64
+	var cacheMaxItems int
+	var cacheTTL, cacheStaleWhileRevalidate time.Duration
+	var cachePaths string
+	var adminPort int
+	var drainTimeoutFlag time.Duration
 	flag.StringVar(&serverList, "backends", "", "Load balanced backends, user comma to seperate")
+	flag.StringVar(&configPath, "config", "", "Path to a JSON file describing backends (overrides -backends); see FileConfig")
 	flag.IntVar(&port, "port", 3030, "Load balancer Port to serve")
+	flag.StringVar(&strategyName, "strategy", "round-robin", "Balancing strategy: round-robin, weighted-round-robin, least-connections, ip-hash, ewma")
+	flag.DurationVar(&backoffInitial, "retry-backoff-initial", DefaultBackoffConfig.Initial, "Initial delay before the first same-backend retry")
+	flag.DurationVar(&backoffMax, "retry-backoff-max", DefaultBackoffConfig.Max, "Maximum base delay between same-backend retries; up to ±50% jitter is applied on top")
+	flag.DurationVar(&backoffMaxElapsed, "retry-max-elapsed", DefaultBackoffConfig.MaxElapsed, "Maximum total time a request may spend on same-backend retries")
+	flag.IntVar(&breakerThreshold, "breaker-failure-threshold", DefaultCircuitBreakerConfig.FailureThreshold, "Consecutive failures within -breaker-window that open a backend's circuit")
+	flag.DurationVar(&breakerWindow, "breaker-window", DefaultCircuitBreakerConfig.Window, "Span a run of consecutive failures must fall within to open the circuit")
+	flag.DurationVar(&breakerCooldown, "breaker-cooldown", DefaultCircuitBreakerConfig.CooldownPeriod, "Time an open circuit is held before a half-open probe is allowed")
+	flag.StringVar(&logFormat, "log-format", "text", "Access log format: text or json")
+	flag.BoolVar(&cacheEnabled, "cache-enabled", DefaultCacheConfig.Enabled, "Cache idempotent GET/HEAD responses in process")
+	flag.Int64Var(&cacheMaxBytes, "cache-max-bytes", DefaultCacheConfig.MaxBytes, "Maximum total size of cached response bodies and headers")
+	flag.IntVar(&cacheMaxItems, "cache-max-items", DefaultCacheConfig.MaxItems, "Maximum number of cached responses")
+	flag.DurationVar(&cacheTTL, "cache-ttl", DefaultCacheConfig.DefaultTTL, "Default TTL for responses with no Cache-Control max-age or Expires")
+	flag.DurationVar(&cacheStaleWhileRevalidate, "cache-stale-while-revalidate", DefaultCacheConfig.StaleWhileRevalidate, "Default stale-while-revalidate window beyond a response's TTL")
+	flag.StringVar(&cachePaths, "cache-paths", "", "Comma-separated path prefixes eligible for caching (empty means all paths)")
+	flag.IntVar(&adminPort, "admin-port", 3031, "Port serving the admin API (backend add/remove/drain, config reload)")
+	flag.DurationVar(&drainTimeoutFlag, "shutdown-timeout", 30*time.Second, "Maximum time to wait for in-flight requests during graceful shutdown")
 
 	flag.Parse()
 	log.SetPrefix("main.go ")
 	log.Println(serverList, " ", port)
 
-	if len(serverList) == 0 {
+	if len(serverList) == 0 && configPath == "" {
 		log.Fatal("Please provide one or more backends to load balance")
 	}
 
-	urls := strings.Split(serverList, ",")
+	var err error
+	accessLogger, err = NewAccessLogger(logFormat)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	strategy, err := newStrategy(strategyName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	serverPool.strategy = strategy
 
-	for _, tok := range urls {
-		serverUrl, err := url.Parse(tok)
+	backoff := BackoffConfig{
+		Initial:    backoffInitial,
+		Multiplier: DefaultBackoffConfig.Multiplier,
+		Max:        backoffMax,
+		MaxElapsed: backoffMaxElapsed,
+	}
+	breakerConfig := CircuitBreakerConfig{
+		FailureThreshold: breakerThreshold,
+		Window:           breakerWindow,
+		CooldownPeriod:   breakerCooldown,
+	}
+
+	var cachePathList []string
+	if cachePaths != "" {
+		cachePathList = strings.Split(cachePaths, ",")
+	}
+	responseCache = NewCache(CacheConfig{
+		Enabled:              cacheEnabled,
+		MaxBytes:             cacheMaxBytes,
+		MaxItems:             cacheMaxItems,
+		DefaultTTL:           cacheTTL,
+		StaleWhileRevalidate: cacheStaleWhileRevalidate,
+		CacheablePaths:       cachePathList,
+	})
+
+	checker := NewHealthChecker(&serverPool)
+
+	if configPath != "" {
+		fileConfig, err := LoadConfig(configPath)
 		if err != nil {
 			log.Fatal(err)
 		}
-		//log.Println(serverUrl)
-
-		proxy := httputil.NewSingleHostReverseProxy(serverUrl)
-		// Implementing error handling funtion using closures, If any error occurs
-		// Retry logic will kicks in and if retrying for 3 times fails, mark backend as dead
-		// and route request to next backend.
-		// Also, adding logic for number of attempts. If request fails for 3 attempts. Send error
-		// response to client
-
-		proxy.ErrorHandler =  func (w http.ResponseWriter, r *http.Request, e error){
-			log.Printf("[%s] %s\n", serverUrl.Host, e.Error())
-			retries := GetRetryFromContext(r)
-
-			if retries > 3 {
-				select {
-				case <- time.After(10 * time.Millisecond):
-					ctx := context.WithValue(r.Context(), Retry, retries + 1)
-					proxy.ServeHTTP(w, r.WithContext(ctx))
-				}
-				return 
+		for _, bc := range fileConfig.Backends {
+			serverUrl, err := url.Parse(bc.URL)
+			if err != nil {
+				log.Fatal(err)
+			}
+			weight := bc.Weight
+			if weight <= 0 {
+				weight = 1
 			}
-			// After 3 retries mark backend down
-			serverPool.MarkBackendStatus(serverUrl, false)
-
-			// Send this request to another backend, increment attempt count
-			// Handle attempts count limit in lb request handler function
-			attempts := GetAttemptsFromContext(r)
-			log.Printf("%s (%s) Attempting request to another backend %d\n", r.RemoteAddr, r.URL.Path, attempts)
-			ctx := context.WithValue(r.Context(), Attempt, attempts+1)
-			lb(w, r.WithContext(ctx))
+			healthConfig, err := bc.HealthCheckConfig(DefaultHealthCheckConfig)
+			if err != nil {
+				log.Fatal(err)
+			}
+			registerBackend(serverUrl, weight, breakerConfig, healthConfig, backoff, checker)
+		}
+	} else {
+		for _, tok := range strings.Split(serverList, ",") {
+			serverUrl, weight, err := parseBackend(tok)
+			if err != nil {
+				log.Fatal(err)
+			}
+			registerBackend(serverUrl, weight, breakerConfig, DefaultHealthCheckConfig, backoff, checker)
 		}
-
-		serverPool.AddBackend(&Backend{
-			URL: serverUrl,
-			Alive: true,
-			ReverseProxy: proxy,
-		})
-		log.Printf("Configured server: %s\n", serverUrl)
 	}
 
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", metrics.Handler(&serverPool))
+	mux.HandleFunc("/", accessLogMiddleware(cacheMiddleware(lb)))
+
 	// create http server
 	server := http.Server{
-		Addr: fmt.Sprintf(":%d", port),
-		Handler: http.HandlerFunc(lb),
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: mux,
 	}
 
-	go healthCheck()
+	admin := NewAdminServer(&serverPool, checker, breakerConfig, backoff, DefaultHealthCheckConfig, configPath)
+	adminServer := http.Server{
+		Addr:    fmt.Sprintf(":%d", adminPort),
+		Handler: admin.Handler(),
+	}
 
-	if err := server.ListenAndServe(); err != nil {
-		log.Fatal(err)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+	go func() {
+		if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+	log.Printf("Load balancer listening on port %d, admin API on port %d\n", port, adminPort)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+	log.Println("Shutdown signal received, draining in-flight requests")
+
+	checker.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeoutFlag)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("load balancer shutdown: %v\n", err)
+	}
+	if err := adminServer.Shutdown(ctx); err != nil {
+		log.Printf("admin server shutdown: %v\n", err)
 	}
-}
\ No newline at end of file
+	log.Println("Shutdown complete")
+}
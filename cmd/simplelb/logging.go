@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+)
+
+// NewAccessLogger builds the *slog.Logger used for per-request access logs,
+// writing to stdout as JSON or human-readable text depending on format.
+func NewAccessLogger(format string) (*slog.Logger, error) {
+	var handler slog.Handler
+	switch format {
+	case "", "text":
+		handler = slog.NewTextHandler(os.Stdout, nil)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stdout, nil)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+	return slog.New(handler), nil
+}
+
+// statusRecorder captures the status code a handler wrote, defaulting to
+// 200 for handlers that never call WriteHeader explicitly.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// withRequestCounters attaches a settable backend string and retry/attempt
+// counters to r's context. lb() fills in the backend, and
+// bumpRetryCounter/bumpAttemptCounter increment the counters in place, so
+// accessLogMiddleware can report them from the original request object after
+// proxy.ErrorHandler's retries and failovers -- which run against contexts
+// derived from r via r.WithContext, never r itself -- have completed.
+func withRequestCounters(r *http.Request) (req *http.Request, backend *string, retries, attempts *int) {
+	backend = new(string)
+	retries = new(int)
+	attempts = new(int)
+	ctx := context.WithValue(r.Context(), ChosenBackend, backend)
+	ctx = context.WithValue(ctx, RetryCounter, retries)
+	ctx = context.WithValue(ctx, AttemptCounter, attempts)
+	return r.WithContext(ctx), backend, retries, attempts
+}
+
+// accessLogMiddleware wraps next with a structured access log line per
+// request: client, method, path, chosen backend, upstream status, upstream
+// latency, retries, and attempts.
+func accessLogMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		r, backend, retries, attempts := withRequestCounters(r)
+
+		next(rec, r)
+
+		accessLogger.Info("request",
+			"client", r.RemoteAddr,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"backend", *backend,
+			"upstream_status", rec.status,
+			"upstream_latency_ms", time.Since(start).Milliseconds(),
+			"retries", *retries,
+			"attempts", *attempts,
+		)
+	}
+}
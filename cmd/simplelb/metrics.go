@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultDurationBuckets are the histogram bucket boundaries (in seconds)
+// used for both lb_request_duration_seconds and
+// lb_health_check_duration_seconds.
+var defaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type requestMetricKey struct {
+	backend string
+	code    int
+}
+
+// Metrics holds the counters and histograms exposed on /metrics in
+// Prometheus text exposition format. All methods are safe for concurrent
+// use.
+type Metrics struct {
+	mutex         sync.Mutex
+	requestsTotal map[requestMetricKey]int64
+	retriesTotal  int64
+
+	requestDuration     *histogram
+	healthCheckDuration *histogram
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requestsTotal:       make(map[requestMetricKey]int64),
+		requestDuration:     newHistogram(defaultDurationBuckets),
+		healthCheckDuration: newHistogram(defaultDurationBuckets),
+	}
+}
+
+// ObserveRequest records the outcome of one upstream request for
+// lb_requests_total and lb_request_duration_seconds.
+func (m *Metrics) ObserveRequest(backend string, code int, duration time.Duration) {
+	m.mutex.Lock()
+	m.requestsTotal[requestMetricKey{backend, code}]++
+	m.mutex.Unlock()
+	m.requestDuration.observe(duration.Seconds())
+}
+
+// IncRetries increments lb_retries_total by one.
+func (m *Metrics) IncRetries() {
+	m.mutex.Lock()
+	m.retriesTotal++
+	m.mutex.Unlock()
+}
+
+// ObserveHealthCheck records one active probe's duration for
+// lb_health_check_duration_seconds.
+func (m *Metrics) ObserveHealthCheck(duration time.Duration) {
+	m.healthCheckDuration.observe(duration.Seconds())
+}
+
+// Handler renders all metrics for pool's current backends in Prometheus
+// text exposition format.
+func (m *Metrics) Handler(pool *ServerPool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.writeTo(w, pool)
+	}
+}
+
+func (m *Metrics) writeTo(w io.Writer, pool *ServerPool) {
+	m.mutex.Lock()
+	requestsTotal := make(map[requestMetricKey]int64, len(m.requestsTotal))
+	for k, v := range m.requestsTotal {
+		requestsTotal[k] = v
+	}
+	retriesTotal := m.retriesTotal
+	m.mutex.Unlock()
+
+	keys := make([]requestMetricKey, 0, len(requestsTotal))
+	for k := range requestsTotal {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].backend != keys[j].backend {
+			return keys[i].backend < keys[j].backend
+		}
+		return keys[i].code < keys[j].code
+	})
+
+	fmt.Fprintln(w, "# HELP lb_requests_total Total requests proxied, by backend and upstream response code.")
+	fmt.Fprintln(w, "# TYPE lb_requests_total counter")
+	for _, k := range keys {
+		fmt.Fprintf(w, "lb_requests_total{backend=%q,code=%q} %d\n", k.backend, strconv.Itoa(k.code), requestsTotal[k])
+	}
+
+	fmt.Fprintln(w, "# HELP lb_retries_total Total same-backend retries issued by proxy.ErrorHandler.")
+	fmt.Fprintln(w, "# TYPE lb_retries_total counter")
+	fmt.Fprintf(w, "lb_retries_total %d\n", retriesTotal)
+
+	fmt.Fprintln(w, "# HELP lb_active_connections In-flight requests currently proxied to a backend.")
+	fmt.Fprintln(w, "# TYPE lb_active_connections gauge")
+	for _, b := range pool.Snapshot() {
+		fmt.Fprintf(w, "lb_active_connections{backend=%q} %d\n", b.URL.String(), b.GetActiveConns())
+	}
+
+	fmt.Fprintln(w, "# HELP lb_backend_up Whether a backend is currently available to take traffic (1) or not (0).")
+	fmt.Fprintln(w, "# TYPE lb_backend_up gauge")
+	for _, b := range pool.Snapshot() {
+		up := 0
+		if b.Available() {
+			up = 1
+		}
+		fmt.Fprintf(w, "lb_backend_up{backend=%q} %d\n", b.URL.String(), up)
+	}
+
+	writeHistogram(w, "lb_request_duration_seconds", "Upstream request duration in seconds.", m.requestDuration)
+	writeHistogram(w, "lb_health_check_duration_seconds", "Active health probe duration in seconds.", m.healthCheckDuration)
+}
+
+// histogram is a minimal cumulative-bucket histogram matching Prometheus's
+// exposition format, hand-rolled to avoid an external client library
+// dependency.
+type histogram struct {
+	mutex   sync.Mutex
+	buckets []float64
+	counts  []int64 // counts[i] is the number of observations <= buckets[i] (cumulative)
+	sum     float64
+	count   int64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]int64, len(buckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.sum += v
+	h.count++
+	for i, le := range h.buckets {
+		if v <= le {
+			h.counts[i]++
+		}
+	}
+}
+
+func (h *histogram) snapshot() (buckets []float64, counts []int64, sum float64, count int64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return append([]float64(nil), h.buckets...), append([]int64(nil), h.counts...), h.sum, h.count
+}
+
+func writeHistogram(w io.Writer, name, help string, h *histogram) {
+	buckets, counts, sum, count := h.snapshot()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+	for i, le := range buckets {
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", name, strconv.FormatFloat(le, 'g', -1, 64), counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, count)
+	fmt.Fprintf(w, "%s_sum %s\n", name, strconv.FormatFloat(sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count %d\n", name, count)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// ServerPool holds the set of backends and delegates peer selection to a
+// pluggable BalancingStrategy. The backend slice can be mutated at runtime
+// (AddBackend/RemoveBackend), so all access goes through the pool's mutex.
+type ServerPool struct {
+	mutex    sync.RWMutex
+	backends []*Backend
+	strategy BalancingStrategy
+}
+
+func (s *ServerPool) AddBackend(backend *Backend) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.backends = append(s.backends, backend)
+}
+
+// RemoveBackend drops the backend matching backendUrl from the pool,
+// reporting whether one was found.
+func (s *ServerPool) RemoveBackend(backendUrl *url.URL) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, b := range s.backends {
+		if b.URL.String() == backendUrl.String() {
+			remaining := make([]*Backend, 0, len(s.backends)-1)
+			remaining = append(remaining, s.backends[:i]...)
+			remaining = append(remaining, s.backends[i+1:]...)
+			s.backends = remaining
+			if evictor, ok := s.strategy.(backendEvictor); ok {
+				evictor.evictBackend(b)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup returns the backend matching backendUrl, or nil if none is in the
+// pool.
+func (s *ServerPool) Lookup(backendUrl *url.URL) *Backend {
+	for _, b := range s.Snapshot() {
+		if b.URL.String() == backendUrl.String() {
+			return b
+		}
+	}
+	return nil
+}
+
+// MarkBackendStatus directly sets backendUrl's Alive flag, doing nothing if
+// no backend in the pool matches backendUrl.
+func (s *ServerPool) MarkBackendStatus(backendUrl *url.URL, alive bool) {
+	b := s.Lookup(backendUrl)
+	if b == nil {
+		return
+	}
+	b.SetAlive(alive)
+}
+
+// RecordBackendFailure feeds a passive failure (from proxy.ErrorHandler) into
+// backendUrl's circuit breaker. It leaves Alive untouched: Available() already
+// consults Breaker.Allow(), so an open circuit excludes the backend from
+// routing on its own, and Breaker.Allow() resolving Open -> HalfOpen lets a
+// probe request through without anything needing to flip Alive back to true
+// first. Alive is reserved for the active health checker and admin drain.
+func (s *ServerPool) RecordBackendFailure(backendUrl *url.URL) {
+	b := s.Lookup(backendUrl)
+	if b == nil {
+		return
+	}
+	b.Breaker.RecordFailure()
+}
+
+// Snapshot returns a copy of the current backend slice, safe to range over
+// without holding the pool's lock and stable against concurrent
+// AddBackend/RemoveBackend calls.
+func (s *ServerPool) Snapshot() []*Backend {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	out := make([]*Backend, len(s.backends))
+	copy(out, s.backends)
+	return out
+}
+
+// GetNextPeer selects the backend that should serve r, using the pool's
+// configured strategy.
+func (s *ServerPool) GetNextPeer(r *http.Request) *Backend {
+	return s.strategy.Select(s.Snapshot(), r)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Probe checks whether a backend is currently healthy.
+type Probe interface {
+	Check(b *Backend) error
+}
+
+// TCPProbe checks health by dialing the backend's host:port and closing the
+// connection. This is the load balancer's original health check behavior.
+type TCPProbe struct {
+	Timeout time.Duration
+}
+
+func (p TCPProbe) Check(b *Backend) error {
+	conn, err := net.DialTimeout("tcp", b.URL.Host, p.Timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// HTTPProbe checks health with an HTTP GET against Path (the backend's own
+// path when empty), accepting any status in ExpectedCodes. An empty
+// ExpectedCodes accepts any 2xx/3xx response. Set TLSInsecureSkipVerify to
+// probe backends with self-signed certificates.
+type HTTPProbe struct {
+	Path                  string
+	ExpectedCodes         []int
+	Timeout               time.Duration
+	TLSInsecureSkipVerify bool
+}
+
+func (p HTTPProbe) Check(b *Backend) error {
+	client := &http.Client{Timeout: p.Timeout}
+	if b.URL.Scheme == "https" {
+		client.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: p.TLSInsecureSkipVerify},
+		}
+	}
+
+	target := *b.URL
+	if p.Path != "" {
+		target.Path = p.Path
+	}
+
+	resp, err := client.Get(target.String())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if !p.codeExpected(resp.StatusCode) {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (p HTTPProbe) codeExpected(code int) bool {
+	if len(p.ExpectedCodes) == 0 {
+		return code >= 200 && code < 400
+	}
+	for _, c := range p.ExpectedCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
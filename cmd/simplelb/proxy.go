@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"time"
+)
+
+// roundTripperFunc adapts a plain function to the http.RoundTripper interface.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// instrumentProxy wraps proxy's Director and Transport so b's ActiveConns and
+// EWMALatency stay up to date: Director counts the request in when it starts,
+// and the Transport wrapper counts it out once the upstream round trip
+// returns (response headers received, or an error), before the response body
+// is copied to the client.
+func instrumentProxy(proxy *httputil.ReverseProxy, b *Backend) {
+	baseDirector := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		baseDirector(req)
+		b.IncActiveConns()
+	}
+
+	transport := proxy.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	proxy.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		start := time.Now()
+		resp, err := transport.RoundTrip(req)
+		duration := time.Since(start)
+		b.UpdateLatency(duration)
+		b.DecActiveConns()
+
+		code := 0
+		if err != nil {
+			b.Breaker.RecordFailure()
+		} else {
+			b.Breaker.RecordSuccess()
+			code = resp.StatusCode
+		}
+		metrics.ObserveRequest(b.URL.String(), code, duration)
+		return resp, err
+	})
+}
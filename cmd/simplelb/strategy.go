@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// BalancingStrategy selects a backend to serve r from the given candidates.
+// It returns nil when none of the candidates can take the request.
+// Implementations must be safe for concurrent use.
+type BalancingStrategy interface {
+	Select(backends []*Backend, r *http.Request) *Backend
+}
+
+// backendEvictor is implemented by strategies that keep per-backend state
+// (keyed by *Backend) needing cleanup when a backend leaves the pool, so
+// ServerPool.RemoveBackend doesn't leak a state entry (and the *Backend it
+// keys on) on every add/remove cycle.
+type backendEvictor interface {
+	evictBackend(b *Backend)
+}
+
+// newStrategy builds the BalancingStrategy named by the -strategy flag.
+func newStrategy(name string) (BalancingStrategy, error) {
+	switch name {
+	case "", "round-robin":
+		return &RoundRobinStrategy{}, nil
+	case "weighted-round-robin":
+		return newWeightedRoundRobinStrategy(), nil
+	case "least-connections":
+		return LeastConnectionsStrategy{}, nil
+	case "ip-hash":
+		return IPHashStrategy{}, nil
+	case "ewma":
+		return EWMAStrategy{}, nil
+	default:
+		return nil, fmt.Errorf("unknown balancing strategy %q", name)
+	}
+}
+
+// aliveBackends filters backends down to the ones currently available:
+// marked alive and not held off by an open circuit breaker.
+func aliveBackends(backends []*Backend) []*Backend {
+	alive := make([]*Backend, 0, len(backends))
+	for _, b := range backends {
+		if b.Available() {
+			alive = append(alive, b)
+		}
+	}
+	return alive
+}
+
+// backendWeight returns b's configured weight, treating an unset (<= 0)
+// weight as 1 so unweighted backends participate equally.
+func backendWeight(b *Backend) int {
+	if w := b.GetWeight(); w > 0 {
+		return w
+	}
+	return 1
+}
+
+// RoundRobinStrategy cycles through backends in order, skipping dead ones.
+// This is the load balancer's original behavior.
+type RoundRobinStrategy struct {
+	currentIndex uint64
+}
+
+func (s *RoundRobinStrategy) Select(backends []*Backend, r *http.Request) *Backend {
+	if len(backends) == 0 {
+		return nil
+	}
+
+	next := int(atomic.AddUint64(&s.currentIndex, 1) % uint64(len(backends)))
+	limit := next + len(backends)
+
+	for i := next; i < limit; i++ {
+		idx := i % len(backends)
+		if backends[idx].Available() {
+			if i != next {
+				atomic.StoreUint64(&s.currentIndex, uint64(idx))
+			}
+			return backends[idx]
+		}
+	}
+	return nil
+}
+
+// weightedRoundRobinState is the per-backend state nginx's smooth weighted
+// round robin algorithm needs to track between selections.
+type weightedRoundRobinState struct {
+	currentWeight int
+}
+
+// WeightedRoundRobinStrategy implements nginx's smooth weighted round robin:
+// each backend's currentWeight is incremented by its weight every round, the
+// backend with the highest currentWeight is picked, then totalWeight is
+// subtracted from it. This spreads selections evenly instead of bursting all
+// of a backend's share at once.
+type WeightedRoundRobinStrategy struct {
+	mutex  sync.Mutex
+	states map[*Backend]*weightedRoundRobinState
+}
+
+func newWeightedRoundRobinStrategy() *WeightedRoundRobinStrategy {
+	return &WeightedRoundRobinStrategy{states: make(map[*Backend]*weightedRoundRobinState)}
+}
+
+func (s *WeightedRoundRobinStrategy) Select(backends []*Backend, r *http.Request) *Backend {
+	alive := aliveBackends(backends)
+	if len(alive) == 0 {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	total := 0
+	var best *Backend
+	var bestState *weightedRoundRobinState
+	for _, b := range alive {
+		weight := backendWeight(b)
+		total += weight
+
+		state, ok := s.states[b]
+		if !ok {
+			state = &weightedRoundRobinState{}
+			s.states[b] = state
+		}
+		state.currentWeight += weight
+
+		if best == nil || state.currentWeight > bestState.currentWeight {
+			best = b
+			bestState = state
+		}
+	}
+
+	bestState.currentWeight -= total
+	return best
+}
+
+// evictBackend drops b's smooth-WRR state, called when b leaves the pool.
+func (s *WeightedRoundRobinStrategy) evictBackend(b *Backend) {
+	s.mutex.Lock()
+	delete(s.states, b)
+	s.mutex.Unlock()
+}
+
+// LeastConnectionsStrategy picks the alive backend with the fewest in-flight
+// requests, breaking ties in favor of the higher-weighted backend.
+type LeastConnectionsStrategy struct{}
+
+func (LeastConnectionsStrategy) Select(backends []*Backend, r *http.Request) *Backend {
+	alive := aliveBackends(backends)
+	if len(alive) == 0 {
+		return nil
+	}
+
+	best := alive[0]
+	for _, b := range alive[1:] {
+		conns, bestConns := b.GetActiveConns(), best.GetActiveConns()
+		if conns < bestConns || (conns == bestConns && backendWeight(b) > backendWeight(best)) {
+			best = b
+		}
+	}
+	return best
+}
+
+// IPHashStrategy hashes the client's address into [0, totalWeight) and walks
+// the weighted ring, so the same client address is sticky to the same
+// backend as long as the set of alive backends doesn't change.
+type IPHashStrategy struct{}
+
+func (IPHashStrategy) Select(backends []*Backend, r *http.Request) *Backend {
+	alive := aliveBackends(backends)
+	if len(alive) == 0 {
+		return nil
+	}
+
+	total := 0
+	for _, b := range alive {
+		total += backendWeight(b)
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(clientHost(r)))
+	target := int(h.Sum32() % uint32(total))
+
+	offset := 0
+	for _, b := range alive {
+		offset += backendWeight(b)
+		if target < offset {
+			return b
+		}
+	}
+	return alive[len(alive)-1]
+}
+
+// clientHost strips the port from r.RemoteAddr so a client keeps the same
+// hash across requests made from different ephemeral ports.
+func clientHost(r *http.Request) string {
+	host := r.RemoteAddr
+	if i := strings.LastIndex(host, ":"); i != -1 {
+		host = host[:i]
+	}
+	return host
+}
+
+// EWMAStrategy picks the alive backend with the lowest exponentially
+// weighted moving average latency, giving backends with no samples yet a
+// chance before comparing them against already-measured peers.
+type EWMAStrategy struct{}
+
+func (EWMAStrategy) Select(backends []*Backend, r *http.Request) *Backend {
+	alive := aliveBackends(backends)
+	if len(alive) == 0 {
+		return nil
+	}
+
+	var best *Backend
+	bestLatency := math.Inf(1)
+	for _, b := range alive {
+		latency := b.GetLatency()
+		if latency == 0 {
+			return b
+		}
+		if latency < bestLatency {
+			best = b
+			bestLatency = latency
+		}
+	}
+	return best
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+// newTestBackend builds a Backend usable by a BalancingStrategy: marked alive
+// or not as given, with a closed circuit breaker, so Available() reflects
+// only what the test sets.
+func newTestBackend(t *testing.T, rawURL string, weight int, alive bool) *Backend {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("url.Parse(%q): %v", rawURL, err)
+	}
+	return &Backend{
+		URL:     u,
+		Alive:   alive,
+		Weight:  weight,
+		Breaker: NewCircuitBreaker(DefaultCircuitBreakerConfig),
+	}
+}
+
+func TestWeightedRoundRobinDistributesByWeight(t *testing.T) {
+	backends := []*Backend{
+		newTestBackend(t, "http://a", 5, true),
+		newTestBackend(t, "http://b", 1, true),
+		newTestBackend(t, "http://c", 1, true),
+	}
+
+	strategy := newWeightedRoundRobinStrategy()
+	counts := make(map[string]int)
+	const rounds = 70 // 10 full cycles of the 7-weight schedule
+	for i := 0; i < rounds; i++ {
+		picked := strategy.Select(backends, nil)
+		if picked == nil {
+			t.Fatalf("round %d: Select returned nil", i)
+		}
+		counts[picked.URL.String()]++
+	}
+
+	// Over full cycles of totalWeight (7), each backend should be picked
+	// proportionally to its weight: a five times, b and c once each per
+	// cycle of 7 selections.
+	wantA, wantB, wantC := rounds*5/7, rounds/7, rounds/7
+	if counts["http://a"] != wantA {
+		t.Errorf("backend a picked %d times, want %d", counts["http://a"], wantA)
+	}
+	if counts["http://b"] != wantB {
+		t.Errorf("backend b picked %d times, want %d", counts["http://b"], wantB)
+	}
+	if counts["http://c"] != wantC {
+		t.Errorf("backend c picked %d times, want %d", counts["http://c"], wantC)
+	}
+}
+
+func TestWeightedRoundRobinSkipsDeadBackends(t *testing.T) {
+	backends := []*Backend{
+		newTestBackend(t, "http://a", 1, false),
+		newTestBackend(t, "http://b", 1, true),
+	}
+
+	strategy := newWeightedRoundRobinStrategy()
+	for i := 0; i < 5; i++ {
+		picked := strategy.Select(backends, nil)
+		if picked == nil || picked.URL.String() != "http://b" {
+			t.Fatalf("round %d: Select() = %v, want http://b", i, picked)
+		}
+	}
+}
+
+func TestWeightedRoundRobinNoBackendsAvailable(t *testing.T) {
+	backends := []*Backend{newTestBackend(t, "http://a", 1, false)}
+	strategy := newWeightedRoundRobinStrategy()
+	if picked := strategy.Select(backends, nil); picked != nil {
+		t.Fatalf("Select() = %v, want nil when no backend is available", picked)
+	}
+}
+
+func TestWeightedRoundRobinEvictBackend(t *testing.T) {
+	a := newTestBackend(t, "http://a", 1, true)
+	b := newTestBackend(t, "http://b", 1, true)
+	backends := []*Backend{a, b}
+
+	strategy := newWeightedRoundRobinStrategy()
+	strategy.Select(backends, nil)
+	if _, tracked := strategy.states[a]; !tracked {
+		t.Fatal("expected a's state to be tracked after selection")
+	}
+
+	strategy.evictBackend(a)
+	if _, tracked := strategy.states[a]; tracked {
+		t.Fatal("evictBackend should remove the backend's state entry")
+	}
+}